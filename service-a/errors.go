@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+// Error is a structured, machine-parseable error modeled on micro's
+// errors.Error. Every failure scenario handler produces one of these
+// instead of an ad-hoc string, so responses stay consistent and an
+// operator can pivot from a trace ID straight to the error that caused it.
+type Error struct {
+	ID     string `json:"id"`
+	Code   int    `json:"code"`
+	Detail string `json:"detail"`
+	Status string `json:"status"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("id=%s code=%d detail=%s", e.ID, e.Code, e.Detail)
+}
+
+func newError(id string, code int, detail string) *Error {
+	return &Error{ID: id, Code: code, Detail: detail, Status: http.StatusText(code)}
+}
+
+func BadRequest(id, detail string) *Error   { return newError(id, http.StatusBadRequest, detail) }
+func Unauthorized(id, detail string) *Error { return newError(id, http.StatusUnauthorized, detail) }
+func Timeout(id, detail string) *Error      { return newError(id, http.StatusGatewayTimeout, detail) }
+func Unavailable(id, detail string) *Error  { return newError(id, http.StatusServiceUnavailable, detail) }
+func Internal(id, detail string) *Error     { return newError(id, http.StatusInternalServerError, detail) }
+
+// asError coerces any error into *Error, wrapping unrecognized errors as
+// internal errors so every failure path produces the same JSON shape.
+func asError(err error) *Error {
+	if err == nil {
+		return nil
+	}
+	if apiErr, ok := err.(*Error); ok {
+		return apiErr
+	}
+	return Internal("internal.unclassified", err.Error())
+}
+
+// writeError renders err as the handler's HTTP response, records it on the
+// current span with the error's ID as an attribute, and includes the trace
+// ID in the body so a caller can correlate the failure with a trace.
+func writeError(ctx context.Context, w http.ResponseWriter, traceID string, err error) {
+	apiErr := asError(err)
+
+	span := oteltrace.SpanFromContext(ctx)
+	span.RecordError(apiErr)
+	span.SetStatus(codes.Error, apiErr.Detail)
+	span.SetAttributes(attribute.String("error.id", apiErr.ID))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(apiErr.Code)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":       apiErr.ID,
+		"code":     apiErr.Code,
+		"detail":   apiErr.Detail,
+		"trace_id": traceID,
+	})
+}
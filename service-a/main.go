@@ -4,7 +4,6 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
 	"os"
@@ -13,15 +12,11 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
-	"go.opentelemetry.io/contrib/instrumentation/github.com/gorilla/mux/otelmux"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
-	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/baggage"
 	"go.opentelemetry.io/otel/propagation"
-	"go.opentelemetry.io/otel/sdk/resource"
-	"go.opentelemetry.io/otel/sdk/trace"
-	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
 	oteltrace "go.opentelemetry.io/otel/trace"
 )
 
@@ -48,6 +43,14 @@ var (
 		Transport: otelhttp.NewTransport(http.DefaultTransport),
 		Timeout:   10 * time.Second,
 	}
+
+	// isPublicEndpoint controls how tracingMiddleware treats an inbound
+	// traceparent header. When true, Service A is assumed to be reachable
+	// directly from the internet, so the extracted remote SpanContext is
+	// recorded as a link on a new local root span instead of being trusted
+	// as the parent - an untrusted caller can no longer splice an arbitrary
+	// trace ID into our internal traces.
+	isPublicEndpoint = getEnv("PUBLIC_ENDPOINT", "false") == "true"
 )
 
 func getEnv(key, defaultValue string) string {
@@ -57,45 +60,6 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
-func initTracer() func() {
-	ctx := context.Background()
-
-	// Create OTLP trace exporter
-	exporter, err := otlptracegrpc.New(ctx,
-		otlptracegrpc.WithEndpoint(getEnv("OTEL_EXPORTER_OTLP_ENDPOINT", "otel-collector:4317")),
-		otlptracegrpc.WithInsecure(),
-	)
-	if err != nil {
-		log.Fatalf("Failed to create trace exporter: %v", err)
-	}
-
-	// Create resource
-	res, err := resource.New(ctx,
-		resource.WithAttributes(
-			semconv.ServiceNameKey.String("service-a"),
-			semconv.ServiceVersionKey.String("1.0.0"),
-		),
-	)
-	if err != nil {
-		log.Fatalf("Failed to create resource: %v", err)
-	}
-
-	// Create trace provider
-	tp := trace.NewTracerProvider(
-		trace.WithBatcher(exporter),
-		trace.WithResource(res),
-	)
-
-	otel.SetTracerProvider(tp)
-	otel.SetTextMapPropagator(propagation.TraceContext{})
-
-	return func() {
-		if err := tp.Shutdown(ctx); err != nil {
-			log.Printf("Error shutting down tracer provider: %v", err)
-		}
-	}
-}
-
 func tracingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Log incoming headers for debugging
@@ -103,17 +67,37 @@ func tracingMiddleware(next http.Handler) http.Handler {
 			r.Header.Get("traceparent"), r.Header.Get("X-Trace-ID"))
 
 		// Extract OpenTelemetry context from incoming headers if present
-		// This ensures we continue an existing distributed trace
-		parentCtx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
-
-		// Check if we have a valid parent trace context
-		parentSpan := oteltrace.SpanFromContext(parentCtx)
-		if parentSpan.SpanContext().IsValid() {
-			log.Printf("Extracted parent OpenTelemetry context from headers")
-			r = r.WithContext(parentCtx)
+		extractedCtx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		remoteSC := oteltrace.SpanContextFromContext(extractedCtx)
+
+		spanName := fmt.Sprintf("%s %s", r.Method, r.URL.Path)
+
+		var ctx context.Context
+		var span oteltrace.Span
+		if isPublicEndpoint {
+			// Service A is internet-facing: don't let an external caller
+			// dictate our trace ID by becoming the parent. Record the
+			// remote context as a link instead, and start a fresh root span.
+			// Baggage isn't a trust decision the way traceparent is, so it
+			// still rides along even though the remote span is only linked.
+			baggageCtx := baggage.ContextWithBaggage(r.Context(), baggage.FromContext(extractedCtx))
+			if remoteSC.IsValid() {
+				log.Printf("Public endpoint: recording remote context as a span link")
+				ctx, span = tracer.Start(baggageCtx, spanName, oteltrace.WithLinks(oteltrace.Link{SpanContext: remoteSC}))
+			} else {
+				ctx, span = tracer.Start(baggageCtx, spanName)
+			}
 		} else {
-			log.Printf("No valid parent context found, using current context")
+			// Internal hop: it's safe to continue the trace as a child.
+			if remoteSC.IsValid() {
+				log.Printf("Extracted parent OpenTelemetry context from headers")
+			} else {
+				log.Printf("No valid parent context found, using current context")
+			}
+			ctx, span = tracer.Start(extractedCtx, spanName)
 		}
+		defer span.End()
+		r = r.WithContext(ctx)
 
 		// Extract or generate trace ID
 		traceID := r.Header.Get("X-Trace-ID")
@@ -123,15 +107,14 @@ func tracingMiddleware(next http.Handler) http.Handler {
 		}
 
 		// Add trace ID to context and response
-		ctx := context.WithValue(r.Context(), "trace_id", traceID)
+		ctx = context.WithValue(ctx, "trace_id", traceID)
 		w.Header().Set("X-Trace-ID", traceID)
 
-		// Add trace ID to current span (this should now be properly connected to parent)
-		if span := oteltrace.SpanFromContext(ctx); span.IsRecording() {
-			span.SetAttributes(attribute.String("trace.id", traceID))
-			span.SetAttributes(attribute.String("http.method", r.Method))
-			span.SetAttributes(attribute.String("http.url", r.URL.String()))
-		}
+		span.SetAttributes(
+			attribute.String("trace.id", traceID),
+			attribute.String("http.method", r.Method),
+			attribute.String("http.url", r.URL.String()),
+		)
 
 		log.Printf("[%s] %s %s - Processing request", traceID, r.Method, r.URL.Path)
 		next.ServeHTTP(w, r.WithContext(ctx))
@@ -142,48 +125,6 @@ func generateTraceID() string {
 	return fmt.Sprintf("trace-%d-%s", time.Now().UnixNano(), uuid.New().String()[:8])
 }
 
-func makeRequest(ctx context.Context, method, url string, traceID string) (*ServiceResponse, error) {
-	span := oteltrace.SpanFromContext(ctx)
-	span.SetAttributes(
-		attribute.String("http.method", method),
-		attribute.String("http.url", url),
-		attribute.String("trace.id", traceID),
-	)
-
-	req, err := http.NewRequestWithContext(ctx, method, url, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	// Propagate trace ID
-	req.Header.Set("X-Trace-ID", traceID)
-	req.Header.Set("Content-Type", "application/json")
-
-	// Propagate OpenTelemetry span context
-	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
-
-	log.Printf("[%s] Making %s request to %s", traceID, method, url)
-
-	resp, err := httpClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("request failed: %w", err)
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
-	}
-
-	var serviceResp ServiceResponse
-	if err := json.Unmarshal(body, &serviceResp); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
-	}
-
-	log.Printf("[%s] Received response from %s: %s", traceID, serviceResp.Service, serviceResp.Message)
-	return &serviceResp, nil
-}
-
 func healthHandler(w http.ResponseWriter, r *http.Request) {
 	traceID := r.Context().Value("trace_id").(string)
 	_, span := tracer.Start(r.Context(), "health_check")
@@ -221,7 +162,7 @@ func parallelHandler(w http.ResponseWriter, r *http.Request) {
 		defer wg.Done()
 		ctx, spanB := tracer.Start(ctx, "call_service_b")
 		defer spanB.End()
-		respB, errB = makeRequest(ctx, "GET", serviceBURL+"/api/process", traceID)
+		respB, errB = serviceBCaller.Do(ctx, "GET", "/api/process", traceID)
 	}()
 
 	// Call Service C
@@ -230,7 +171,7 @@ func parallelHandler(w http.ResponseWriter, r *http.Request) {
 		defer wg.Done()
 		ctx, spanC := tracer.Start(ctx, "call_service_c")
 		defer spanC.End()
-		respC, errC = makeRequest(ctx, "GET", serviceCURL+"/api/process", traceID)
+		respC, errC = serviceCCaller.Do(ctx, "GET", "/api/process", traceID)
 	}()
 
 	wg.Wait()
@@ -273,25 +214,27 @@ func sequentialHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Call Service B first
 	ctx, spanB := tracer.Start(ctx, "call_service_b")
-	respB, errB := makeRequest(ctx, "GET", serviceBURL+"/api/process", traceID)
-	spanB.End()
+	respB, errB := serviceBCaller.Do(ctx, "GET", "/api/process", traceID)
 
 	if errB != nil {
 		log.Printf("[%s] Error calling Service B: %v", traceID, errB)
-		http.Error(w, fmt.Sprintf("Failed to call Service B: %v", errB), http.StatusInternalServerError)
+		writeError(ctx, w, traceID, errB)
+		spanB.End()
 		return
 	}
+	spanB.End()
 
 	// Then call Service C
 	ctx, spanC := tracer.Start(ctx, "call_service_c")
-	respC, errC := makeRequest(ctx, "GET", serviceCURL+"/api/process", traceID)
-	spanC.End()
+	respC, errC := serviceCCaller.Do(ctx, "GET", "/api/process", traceID)
 
 	if errC != nil {
 		log.Printf("[%s] Error calling Service C: %v", traceID, errC)
-		http.Error(w, fmt.Sprintf("Failed to call Service C: %v", errC), http.StatusInternalServerError)
+		writeError(ctx, w, traceID, errC)
+		spanC.End()
 		return
 	}
+	spanC.End()
 
 	response := Response{
 		Service:   "service-a",
@@ -349,7 +292,7 @@ func timeoutFailureHandler(w http.ResponseWriter, r *http.Request) {
 		defer wg.Done()
 		ctx, spanB := tracer.Start(ctx, "call_service_b_normal")
 		defer spanB.End()
-		respB, errB = makeRequest(ctx, "GET", serviceBURL+"/api/process", traceID)
+		respB, errB = serviceBCaller.Do(ctx, "GET", "/api/process", traceID)
 	}()
 
 	// Call Service C with error endpoint to simulate failure
@@ -358,7 +301,7 @@ func timeoutFailureHandler(w http.ResponseWriter, r *http.Request) {
 		defer wg.Done()
 		ctx, spanC := tracer.Start(ctx, "call_service_c_error")
 		defer spanC.End()
-		respC, errC = makeRequest(ctx, "GET", serviceCURL+"/api/timeout", traceID)
+		respC, errC = serviceCCaller.Do(ctx, "GET", "/api/timeout", traceID)
 	}()
 
 	wg.Wait()
@@ -405,25 +348,24 @@ func partialFailureHandler(w http.ResponseWriter, r *http.Request) {
 
 	// First call Service B (should succeed)
 	ctx, spanB := tracer.Start(ctx, "call_service_b_success")
-	respB, errB := makeRequest(ctx, "GET", serviceBURL+"/api/process", traceID)
-	spanB.End()
+	respB, errB := serviceBCaller.Do(ctx, "GET", "/api/process", traceID)
 
 	if errB != nil {
 		log.Printf("[%s] Unexpected error in Service B: %v", traceID, errB)
-		http.Error(w, fmt.Sprintf("Unexpected failure in Service B: %v", errB), http.StatusInternalServerError)
+		writeError(ctx, w, traceID, errB)
+		spanB.End()
 		return
 	}
+	spanB.End()
 
 	// Then call Service C with error endpoint (should fail)
 	ctx, spanC := tracer.Start(ctx, "call_service_c_intentional_error")
-	_, errC := makeRequest(ctx, "GET", serviceCURL+"/api/error", traceID)
+	_, errC := serviceCCaller.Do(ctx, "GET", "/api/error", traceID)
 	spanC.End()
 
-	var serviceCError string
+	var serviceCError *Error
 	if errC != nil {
-		serviceCError = errC.Error()
-	} else {
-		serviceCError = "No error occurred (unexpected)"
+		serviceCError = asError(errC)
 	}
 
 	response := Response{
@@ -439,7 +381,8 @@ func partialFailureHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if errC != nil {
-		span.RecordError(errC)
+		span.RecordError(serviceCError)
+		span.SetAttributes(attribute.String("error.id", serviceCError.ID))
 		log.Printf("[%s] Expected error in Service C: %v", traceID, errC)
 	}
 
@@ -458,27 +401,27 @@ func cascadeFailureHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Call Service B first
 	ctx, spanB := tracer.Start(ctx, "call_service_b_before_cascade")
-	respB, errB := makeRequest(ctx, "GET", serviceBURL+"/api/process", traceID)
-	spanB.End()
+	respB, errB := serviceBCaller.Do(ctx, "GET", "/api/process", traceID)
 
 	if errB != nil {
 		log.Printf("[%s] Service B failed, cascading failure: %v", traceID, errB)
-		span.RecordError(errB)
-		http.Error(w, fmt.Sprintf("Cascade failure started at Service B: %v", errB), http.StatusInternalServerError)
+		writeError(ctx, w, traceID, errB)
+		spanB.End()
 		return
 	}
+	spanB.End()
 
 	// Now call Service C which will call Service A (circular), but we'll make it fail
 	ctx, spanC := tracer.Start(ctx, "call_service_c_cascade")
-	respC, errC := makeRequest(ctx, "GET", serviceCURL+"/api/call-service-a-error", traceID)
-	spanC.End()
+	respC, errC := serviceCCaller.Do(ctx, "GET", "/api/call-service-a-error", traceID)
 
 	if errC != nil {
 		log.Printf("[%s] Cascade failure propagated through Service C: %v", traceID, errC)
-		span.RecordError(errC)
-		http.Error(w, fmt.Sprintf("Cascade failure propagated: %v", errC), http.StatusInternalServerError)
+		writeError(ctx, w, traceID, errC)
+		spanC.End()
 		return
 	}
+	spanC.End()
 
 	response := Response{
 		Service:   "service-a",
@@ -508,37 +451,39 @@ func chainFailureHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Step 1: Call Service B (should succeed)
 	ctx, spanB1 := tracer.Start(ctx, "chain_step_1_service_b")
-	respB1, errB1 := makeRequest(ctx, "GET", serviceBURL+"/api/process", traceID)
-	spanB1.End()
+	respB1, errB1 := serviceBCaller.Do(ctx, "GET", "/api/process", traceID)
 
 	if errB1 != nil {
 		log.Printf("[%s] Chain failure at step 1 (Service B): %v", traceID, errB1)
-		span.RecordError(errB1)
-		http.Error(w, fmt.Sprintf("Chain broken at step 1: %v", errB1), http.StatusInternalServerError)
+		writeError(ctx, w, traceID, errB1)
+		spanB1.End()
 		return
 	}
+	spanB1.End()
 
 	// Step 2: Call Service C (should succeed)
 	ctx, spanC1 := tracer.Start(ctx, "chain_step_2_service_c")
-	respC1, errC1 := makeRequest(ctx, "GET", serviceCURL+"/api/process", traceID)
-	spanC1.End()
+	respC1, errC1 := serviceCCaller.Do(ctx, "GET", "/api/process", traceID)
 
 	if errC1 != nil {
 		log.Printf("[%s] Chain failure at step 2 (Service C): %v", traceID, errC1)
-		span.RecordError(errC1)
-		http.Error(w, fmt.Sprintf("Chain broken at step 2: %v", errC1), http.StatusInternalServerError)
+		writeError(ctx, w, traceID, errC1)
+		spanC1.End()
 		return
 	}
+	spanC1.End()
 
 	// Step 3: Call Service B with error (should fail)
 	ctx, spanB2 := tracer.Start(ctx, "chain_step_3_service_b_error")
-	respB2, errB2 := makeRequest(ctx, "GET", serviceBURL+"/api/error", traceID)
+	respB2, errB2 := serviceBCaller.Do(ctx, "GET", "/api/error", traceID)
 	spanB2.End()
 
 	// This step is expected to fail
 	if errB2 != nil {
 		log.Printf("[%s] Expected chain failure at step 3 (Service B error): %v", traceID, errB2)
-		span.RecordError(errB2)
+		apiErr := asError(errB2)
+		span.RecordError(apiErr)
+		span.SetAttributes(attribute.String("error.id", apiErr.ID))
 
 		response := Response{
 			Service:   "service-a",
@@ -548,7 +493,7 @@ func chainFailureHandler(w http.ResponseWriter, r *http.Request) {
 			Data: map[string]interface{}{
 				"step_1_success": respB1,
 				"step_2_success": respC1,
-				"step_3_failure": errB2.Error(),
+				"step_3_failure": apiErr,
 				"scenario":       "chain_failure_at_step_3",
 			},
 		}
@@ -579,14 +524,22 @@ func chainFailureHandler(w http.ResponseWriter, r *http.Request) {
 
 func main() {
 	// Initialize tracing
-	shutdown := initTracer()
-	defer shutdown()
+	shutdown, err := initTracer(context.Background())
+	if err != nil {
+		log.Fatalf("Failed to initialize tracing: %v", err)
+	}
+	defer func() {
+		if err := shutdown(context.Background()); err != nil {
+			log.Printf("Error shutting down tracer provider: %v", err)
+		}
+	}()
 
 	// Create router
 	r := mux.NewRouter()
 
-	// Add OpenTelemetry middleware
-	r.Use(otelmux.Middleware("service-a"))
+	// Add OpenTelemetry middleware. tracingMiddleware owns span creation so
+	// it can decide between continuing the trace and starting a linked root
+	// span (see isPublicEndpoint).
 	r.Use(tracingMiddleware)
 
 	// Routes
@@ -601,6 +554,11 @@ func main() {
 	r.HandleFunc("/api/failure/cascade", cascadeFailureHandler).Methods("GET")
 	r.HandleFunc("/api/failure/chain", chainFailureHandler).Methods("GET")
 
+	// Debug routes
+	r.HandleFunc("/debug/breakers", debugBreakersHandler).Methods("GET")
+	r.HandleFunc("/debug/introspect", debugIntrospectHandler).Methods("GET")
+	r.HandleFunc("/debug/runtime", debugRuntimeHandler).Methods("GET")
+
 	log.Println("Service A starting on :8080")
 	log.Fatal(http.ListenAndServe(":8080", r))
 }
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// withTestTracerProvider installs an in-memory span recorder as the global
+// tracer provider for the duration of a test and returns it alongside a
+// restore func, so tracingMiddleware's package-level tracer records spans we
+// can assert on without needing a real collector. It also installs a
+// TraceContext propagator, since the real one is only registered by
+// initTracer, which tests never run - without it, traceparent extraction is
+// a no-op and every span comes back with no parent and no links.
+func withTestTracerProvider(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	prevTP := otel.GetTracerProvider()
+	prevPropagator := otel.GetTextMapPropagator()
+	prevTracer := tracer
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	tracer = tp.Tracer("service-a")
+
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prevTP)
+		otel.SetTextMapPropagator(prevPropagator)
+		tracer = prevTracer
+	})
+
+	return exporter
+}
+
+const inboundTraceparent = "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"
+
+func TestTracingMiddleware_PublicEndpointLinksInsteadOfParenting(t *testing.T) {
+	exporter := withTestTracerProvider(t)
+
+	prevPublic := isPublicEndpoint
+	isPublicEndpoint = true
+	t.Cleanup(func() { isPublicEndpoint = prevPublic })
+
+	req := httptest.NewRequest(http.MethodGet, "/health", nil)
+	req.Header.Set("traceparent", inboundTraceparent)
+	rec := httptest.NewRecorder()
+
+	tracingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})).ServeHTTP(rec, req)
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("expected 1 recorded span, got %d", len(spans))
+	}
+	got := spans[0]
+
+	if got.Parent.IsValid() {
+		t.Fatalf("public endpoint span should be a root span with no parent, got parent %+v", got.Parent)
+	}
+	if len(got.Links) != 1 {
+		t.Fatalf("expected exactly one link recording the inbound context, got %d", len(got.Links))
+	}
+	if got.Links[0].SpanContext.TraceID().String() == got.SpanContext.TraceID().String() {
+		t.Fatalf("linked span context should carry the inbound trace ID, not the new root's")
+	}
+}
+
+func TestTracingMiddleware_InternalHopContinuesAsChild(t *testing.T) {
+	exporter := withTestTracerProvider(t)
+
+	prevPublic := isPublicEndpoint
+	isPublicEndpoint = false
+	t.Cleanup(func() { isPublicEndpoint = prevPublic })
+
+	req := httptest.NewRequest(http.MethodGet, "/health", nil)
+	req.Header.Set("traceparent", inboundTraceparent)
+	rec := httptest.NewRecorder()
+
+	tracingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})).ServeHTTP(rec, req)
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("expected 1 recorded span, got %d", len(spans))
+	}
+	got := spans[0]
+
+	if len(got.Links) != 0 {
+		t.Fatalf("internal hop should not record a link, got %d", len(got.Links))
+	}
+	if !got.Parent.IsValid() {
+		t.Fatalf("internal hop span should continue the inbound context as its parent")
+	}
+	if got.SpanContext.TraceID().String() != got.Parent.TraceID().String() {
+		t.Fatalf("internal hop span should share the inbound trace ID as a child, got trace %s vs parent trace %s",
+			got.SpanContext.TraceID(), got.Parent.TraceID())
+	}
+}
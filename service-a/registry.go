@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"sync"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// SpanRecord is a point-in-time snapshot of a currently active span, kept
+// around only long enough to answer introspection queries.
+type SpanRecord struct {
+	SpanID     string            `json:"span_id"`
+	TraceID    string            `json:"trace_id"`
+	Name       string            `json:"name"`
+	StartTime  time.Time         `json:"start_time"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// SpanRegistry is a sdktrace.SpanProcessor that mirrors every currently
+// active span into a concurrent map keyed by span ID, following the
+// tchannel _gometa_introspect pattern: operators can inspect what's
+// in-flight right now without waiting for spans to be batched and exported.
+type SpanRegistry struct {
+	mu    sync.RWMutex
+	spans map[string]*SpanRecord
+}
+
+func NewSpanRegistry() *SpanRegistry {
+	return &SpanRegistry{spans: make(map[string]*SpanRecord)}
+}
+
+func (reg *SpanRegistry) OnStart(_ context.Context, s sdktrace.ReadWriteSpan) {
+	spanID := s.SpanContext().SpanID().String()
+
+	attrs := make(map[string]string, len(s.Attributes()))
+	for _, kv := range s.Attributes() {
+		attrs[string(kv.Key)] = kv.Value.Emit()
+	}
+
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	reg.spans[spanID] = &SpanRecord{
+		SpanID:     spanID,
+		TraceID:    s.SpanContext().TraceID().String(),
+		Name:       s.Name(),
+		StartTime:  s.StartTime(),
+		Attributes: attrs,
+	}
+}
+
+func (reg *SpanRegistry) OnEnd(s sdktrace.ReadOnlySpan) {
+	spanID := s.SpanContext().SpanID().String()
+
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	delete(reg.spans, spanID)
+}
+
+func (reg *SpanRegistry) Shutdown(context.Context) error   { return nil }
+func (reg *SpanRegistry) ForceFlush(context.Context) error { return nil }
+
+// Snapshot returns a copy of the currently active spans.
+func (reg *SpanRegistry) Snapshot() []SpanRecord {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+
+	out := make([]SpanRecord, 0, len(reg.spans))
+	for _, s := range reg.spans {
+		out = append(out, *s)
+	}
+	return out
+}
+
+var spanRegistry = NewSpanRegistry()
+
+// InFlightCall is an outbound HTTP call that hasn't returned yet, derived
+// from the live http.retry.attempt spans in spanRegistry.
+type InFlightCall struct {
+	Target    string    `json:"target"`
+	URL       string    `json:"url"`
+	Attempt   string    `json:"attempt"`
+	StartTime time.Time `json:"start_time"`
+	Elapsed   int64     `json:"elapsed_ms"`
+}
+
+func inFlightCalls(spans []SpanRecord) []InFlightCall {
+	calls := make([]InFlightCall, 0)
+	for _, s := range spans {
+		if s.Name != "http.retry.attempt" {
+			continue
+		}
+		calls = append(calls, InFlightCall{
+			Target:    s.Attributes["http.target"],
+			URL:       s.Attributes["http.url"],
+			Attempt:   s.Attributes["retry.attempt"],
+			StartTime: s.StartTime,
+			Elapsed:   time.Since(s.StartTime).Milliseconds(),
+		})
+	}
+	return calls
+}
+
+func debugIntrospectHandler(w http.ResponseWriter, r *http.Request) {
+	spans := spanRegistry.Snapshot()
+
+	response := map[string]interface{}{
+		"active_spans":    spans,
+		"in_flight_calls": inFlightCalls(spans),
+		"goroutines":      runtime.NumGoroutine(),
+	}
+
+	if r.URL.Query().Get("includeGoStacks") == "true" {
+		buf := make([]byte, 1<<20)
+		n := runtime.Stack(buf, true)
+		response["goroutine_stacks"] = string(buf[:n])
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+var processStartTime = time.Now()
+
+func debugRuntimeHandler(w http.ResponseWriter, r *http.Request) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	response := map[string]interface{}{
+		"goroutines":       runtime.NumGoroutine(),
+		"num_cpu":          runtime.NumCPU(),
+		"gomaxprocs":       runtime.GOMAXPROCS(0),
+		"uptime_seconds":   time.Since(processStartTime).Seconds(),
+		"heap_alloc_bytes": mem.HeapAlloc,
+		"heap_objects":     mem.HeapObjects,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
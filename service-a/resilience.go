@@ -0,0 +1,450 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+// BreakerState is the state of a CircuitBreaker.
+type BreakerState int
+
+const (
+	BreakerClosed BreakerState = iota
+	BreakerOpen
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// RetryPolicy configures jittered exponential backoff between attempts.
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+}
+
+// backoffFor returns the jittered backoff to wait before the given attempt
+// (attempt is 1-indexed; attempt 1 never waits).
+func (p RetryPolicy) backoffFor(attempt int) time.Duration {
+	if attempt <= 1 {
+		return 0
+	}
+	backoff := p.BaseBackoff << (attempt - 2)
+	if backoff > p.MaxBackoff || backoff <= 0 {
+		backoff = p.MaxBackoff
+	}
+	// Full jitter: a random duration between 0 and backoff.
+	return time.Duration(rand.Int63n(int64(backoff) + 1))
+}
+
+// CircuitBreaker is a simple closed/open/half-open breaker keyed by the
+// failure rate over a rolling window of the most recent windowSize calls:
+// outcomes age out of the window as new ones arrive, so a failure burst
+// after a long healthy streak still crosses the threshold.
+type CircuitBreaker struct {
+	mu               sync.Mutex
+	state            BreakerState
+	failureThreshold float64
+	minRequests      int
+	windowSize       int
+	cooldown         time.Duration
+	outcomes         []bool // ring buffer of recent outcomes; true = failure
+	outcomeHead      int
+	failures         int // failures currently within the window
+	openedAt         time.Time
+	halfOpenInFlight bool
+}
+
+func NewCircuitBreaker(failureThreshold float64, minRequests, windowSize int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		failureThreshold: failureThreshold,
+		minRequests:      minRequests,
+		windowSize:       windowSize,
+		cooldown:         cooldown,
+		outcomes:         make([]bool, 0, windowSize),
+	}
+}
+
+// recordOutcome pushes a call outcome into the rolling window, evicting the
+// oldest outcome once the window is full.
+func (b *CircuitBreaker) recordOutcome(failed bool) {
+	if len(b.outcomes) < b.windowSize {
+		b.outcomes = append(b.outcomes, failed)
+		if failed {
+			b.failures++
+		}
+		return
+	}
+
+	if b.outcomes[b.outcomeHead] {
+		b.failures--
+	}
+	b.outcomes[b.outcomeHead] = failed
+	if failed {
+		b.failures++
+	}
+	b.outcomeHead = (b.outcomeHead + 1) % b.windowSize
+}
+
+// Allow reports whether a call may proceed. It also performs the
+// open -> half-open transition once the cooldown has elapsed.
+func (b *CircuitBreaker) Allow() (allowed bool, from, to BreakerState, transitioned bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return false, b.state, b.state, false
+		}
+		from := b.state
+		b.state = BreakerHalfOpen
+		b.halfOpenInFlight = true
+		return true, from, b.state, true
+	case BreakerHalfOpen:
+		if b.halfOpenInFlight {
+			return false, b.state, b.state, false
+		}
+		b.halfOpenInFlight = true
+		return true, b.state, b.state, false
+	default:
+		return true, b.state, b.state, false
+	}
+}
+
+// RecordSuccess reports a successful call outcome.
+func (b *CircuitBreaker) RecordSuccess() (from, to BreakerState, transitioned bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerHalfOpen {
+		from := b.state
+		b.reset()
+		return from, b.state, true
+	}
+	b.recordOutcome(false)
+	return b.state, b.state, false
+}
+
+// RecordFailure reports a failed call outcome, tripping the breaker when
+// the failure rate crosses the configured threshold.
+func (b *CircuitBreaker) RecordFailure() (from, to BreakerState, transitioned bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerHalfOpen {
+		from := b.state
+		b.trip()
+		return from, b.state, true
+	}
+
+	b.recordOutcome(true)
+	if len(b.outcomes) >= b.minRequests && float64(b.failures)/float64(len(b.outcomes)) >= b.failureThreshold {
+		from := b.state
+		b.trip()
+		return from, b.state, true
+	}
+	return b.state, b.state, false
+}
+
+func (b *CircuitBreaker) trip() {
+	b.state = BreakerOpen
+	b.openedAt = time.Now()
+	b.halfOpenInFlight = false
+}
+
+func (b *CircuitBreaker) reset() {
+	b.state = BreakerClosed
+	b.outcomes = b.outcomes[:0]
+	b.outcomeHead = 0
+	b.failures = 0
+	b.halfOpenInFlight = false
+}
+
+// BreakerSnapshot is the JSON shape returned by /debug/breakers.
+type BreakerSnapshot struct {
+	Target   string  `json:"target"`
+	State    string  `json:"state"`
+	Requests int     `json:"requests"`
+	Failures int     `json:"failures"`
+	Rate     float64 `json:"failure_rate"`
+}
+
+func (b *CircuitBreaker) snapshot(target string) BreakerSnapshot {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	requests := len(b.outcomes)
+	rate := 0.0
+	if requests > 0 {
+		rate = float64(b.failures) / float64(requests)
+	}
+	return BreakerSnapshot{
+		Target:   target,
+		State:    b.state.String(),
+		Requests: requests,
+		Failures: b.failures,
+		Rate:     rate,
+	}
+}
+
+// HTTPCaller wraps outbound calls to a single downstream target with a
+// retry policy and a per-host circuit breaker, recording a child span for
+// every attempt and every breaker state transition.
+type HTTPCaller struct {
+	name        string
+	routes      RouteTable
+	client      *http.Client
+	retry       RetryPolicy
+	callTimeout time.Duration
+	breaker     *CircuitBreaker
+}
+
+// NewHTTPCaller builds an HTTPCaller for target, reading its retry,
+// breaker, and baggage-routing configuration from <TARGET>_* environment
+// variables (e.g. SERVICE_B_MAX_ATTEMPTS, SERVICE_B_BREAKER_COOLDOWN_MS,
+// SERVICE_B_BREAKER_WINDOW_SIZE, SERVICE_B_ROUTES).
+func NewHTTPCaller(target, baseURL string, client *http.Client) *HTTPCaller {
+	prefix := target
+	return &HTTPCaller{
+		name:    target,
+		routes:  NewRouteTable(baseURL, getEnv(prefix+"_ROUTES", "")),
+		client:  client,
+		retry: RetryPolicy{
+			MaxAttempts: atLeast(getEnvInt(prefix+"_MAX_ATTEMPTS", 3), 1),
+			BaseBackoff: getEnvMillis(prefix+"_BASE_BACKOFF_MS", 100),
+			MaxBackoff:  getEnvMillis(prefix+"_MAX_BACKOFF_MS", 2000),
+		},
+		callTimeout: getEnvMillis(prefix+"_CALL_TIMEOUT_MS", 5000),
+		breaker: NewCircuitBreaker(
+			getEnvFloat(prefix+"_BREAKER_FAILURE_THRESHOLD", 0.5),
+			getEnvInt(prefix+"_BREAKER_MIN_REQUESTS", 5),
+			getEnvInt(prefix+"_BREAKER_WINDOW_SIZE", 20),
+			getEnvMillis(prefix+"_BREAKER_COOLDOWN_MS", 10000),
+		),
+	}
+}
+
+// isRetryable reports whether err is worth retrying. Client errors (4xx) are
+// the caller's fault and won't succeed on a second attempt, so only timeouts
+// and server-side failures (5xx) are retried.
+func isRetryable(err error) bool {
+	apiErr, ok := err.(*Error)
+	if !ok {
+		return true
+	}
+	return apiErr.Code >= http.StatusInternalServerError
+}
+
+// Do calls path on the caller's target, retrying on failure per the retry
+// policy as long as the circuit breaker stays closed (or half-open).
+func (c *HTTPCaller) Do(ctx context.Context, method, path, traceID string) (*ServiceResponse, error) {
+	allowed, from, to, transitioned := c.breaker.Allow()
+	if transitioned {
+		c.recordStateChange(ctx, from, to, nil)
+	}
+	if !allowed {
+		return nil, Unavailable("http.circuit_open", fmt.Sprintf("circuit breaker open for %s", c.name))
+	}
+
+	url := c.routes.Resolve(ctx) + path
+
+	var lastErr error
+	for attempt := 1; attempt <= c.retry.MaxAttempts; attempt++ {
+		backoff := c.retry.backoffFor(attempt)
+		if backoff > 0 {
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return nil, Timeout("http.retry_cancelled", ctx.Err().Error())
+			}
+		}
+
+		// Attributes are passed at Start time (rather than via SetAttributes
+		// after) so spanRegistry.OnStart, which snapshots attributes as soon
+		// as the span begins, actually sees them.
+		attemptCtx, span := tracer.Start(ctx, "http.retry.attempt", oteltrace.WithAttributes(
+			attribute.String("http.target", c.name),
+			attribute.String("http.url", url),
+			attribute.Int("retry.attempt", attempt),
+			attribute.Int64("retry.backoff_ms", backoff.Milliseconds()),
+		))
+		for _, member := range routeBaggageMembers(ctx) {
+			span.SetAttributes(attribute.String("baggage."+member.Key(), member.Value()))
+		}
+
+		callCtx, cancel := context.WithTimeout(attemptCtx, c.callTimeout)
+		resp, err := doHTTPRequest(callCtx, c.client, method, url, traceID)
+		cancel()
+
+		if err == nil {
+			span.End()
+			if from, to, transitioned := c.breaker.RecordSuccess(); transitioned {
+				c.recordStateChange(ctx, from, to, nil)
+			}
+			return resp, nil
+		}
+
+		lastErr = err
+		span.RecordError(err)
+		span.SetAttributes(
+			attribute.String("retry.last_error", err.Error()),
+			attribute.Bool("retry.retryable", isRetryable(err)),
+		)
+		span.End()
+
+		from, to, transitioned := c.breaker.RecordFailure()
+		if transitioned {
+			c.recordStateChange(ctx, from, to, err)
+		}
+		if transitioned || !isRetryable(err) {
+			break
+		}
+	}
+
+	return nil, lastErr
+}
+
+func (c *HTTPCaller) recordStateChange(ctx context.Context, from, to BreakerState, cause error) {
+	_, span := tracer.Start(ctx, "http.circuit_breaker.state_change")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("http.target", c.name),
+		attribute.String("breaker.from", from.String()),
+		attribute.String("breaker.to", to.String()),
+	)
+	if cause != nil {
+		span.SetAttributes(attribute.String("breaker.last_error", cause.Error()))
+	}
+	log.Printf("Circuit breaker for %s transitioned %s -> %s", c.name, from, to)
+}
+
+// doHTTPRequest performs a single outbound call and decodes the response,
+// the low-level building block HTTPCaller retries on top of.
+func doHTTPRequest(ctx context.Context, client *http.Client, method, url, traceID string) (*ServiceResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return nil, Internal("http.request_create_failed", err.Error())
+	}
+
+	req.Header.Set("X-Trace-ID", traceID)
+	req.Header.Set("Content-Type", "application/json")
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	log.Printf("[%s] Making %s request to %s", traceID, method, url)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return nil, Timeout("http.timeout", err.Error())
+		}
+		return nil, Unavailable("http.unavailable", err.Error())
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, Internal("http.read_failed", err.Error())
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, errorFromStatus(resp.StatusCode, body)
+	}
+
+	var serviceResp ServiceResponse
+	if err := json.Unmarshal(body, &serviceResp); err != nil {
+		return nil, Internal("http.decode_failed", err.Error())
+	}
+
+	log.Printf("[%s] Received response from %s: %s", traceID, serviceResp.Service, serviceResp.Message)
+	return &serviceResp, nil
+}
+
+// errorFromStatus turns a non-2xx downstream response into an *Error (5xx as
+// a retryable Unavailable, anything else as a non-retryable BadRequest),
+// preserving the upstream error's ID/detail when body is itself a
+// writeError envelope so the original failure stays visible end to end.
+func errorFromStatus(statusCode int, body []byte) error {
+	var upstream Error
+	if err := json.Unmarshal(body, &upstream); err == nil && upstream.ID != "" {
+		upstream.Status = http.StatusText(statusCode)
+		return &upstream
+	}
+
+	detail := fmt.Sprintf("downstream returned %d", statusCode)
+	if statusCode >= 500 {
+		return Unavailable("http.downstream_error", detail)
+	}
+	return BadRequest("http.downstream_error", detail)
+}
+
+var (
+	serviceBCaller = NewHTTPCaller("SERVICE_B", serviceBURL, httpClient)
+	serviceCCaller = NewHTTPCaller("SERVICE_C", serviceCURL, httpClient)
+	allCallers     = []*HTTPCaller{serviceBCaller, serviceCCaller}
+)
+
+func debugBreakersHandler(w http.ResponseWriter, r *http.Request) {
+	snapshots := make([]BreakerSnapshot, 0, len(allCallers))
+	for _, c := range allCallers {
+		snapshots = append(snapshots, c.breaker.snapshot(c.name))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(snapshots)
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	if value := getEnv(key, ""); value != "" {
+		if n, err := strconv.Atoi(value); err == nil {
+			return n
+		}
+	}
+	return defaultValue
+}
+
+func getEnvFloat(key string, defaultValue float64) float64 {
+	if value := getEnv(key, ""); value != "" {
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return f
+		}
+	}
+	return defaultValue
+}
+
+func getEnvMillis(key string, defaultMillis int) time.Duration {
+	return time.Duration(getEnvInt(key, defaultMillis)) * time.Millisecond
+}
+
+// atLeast clamps n up to min, guarding against a misconfigured env var (e.g.
+// <TARGET>_MAX_ATTEMPTS=0) disabling a retry loop outright.
+func atLeast(n, min int) int {
+	if n < min {
+		return min
+	}
+	return n
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	"go.opentelemetry.io/otel/baggage"
+)
+
+// routeBaggagePrefix marks baggage entries the router subsystem inspects to
+// pick a downstream base URL, e.g. "route.tier=canary" or "route.region=eu".
+const routeBaggagePrefix = "route."
+
+// RouteTable resolves a downstream base URL for a target, preferring an
+// alternative selected by a "route.*" baggage entry over the default.
+// This is the OTel-baggage equivalent of a go-micro label selector.
+type RouteTable struct {
+	Default       string
+	byBaggageSpec map[string]string // "route.tier=canary" -> base URL
+}
+
+// NewRouteTable builds a RouteTable whose alternatives are loaded from a
+// <TARGET>_ROUTES env var formatted as "key=value=>url;key=value=>url".
+func NewRouteTable(defaultURL string, routesEnv string) RouteTable {
+	alternatives := make(map[string]string)
+	for _, entry := range strings.Split(routesEnv, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, "=>", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		alternatives[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+	return RouteTable{Default: defaultURL, byBaggageSpec: alternatives}
+}
+
+// Resolve picks a base URL for ctx's baggage, falling back to Default when
+// no "route.*" entry matches a configured alternative.
+func (rt RouteTable) Resolve(ctx context.Context) string {
+	for _, member := range baggage.FromContext(ctx).Members() {
+		if !strings.HasPrefix(member.Key(), routeBaggagePrefix) {
+			continue
+		}
+		spec := member.Key() + "=" + member.Value()
+		if url, ok := rt.byBaggageSpec[spec]; ok {
+			return url
+		}
+	}
+	return rt.Default
+}
+
+// routeBaggageMembers returns the "route.*" baggage members on ctx, for
+// attaching as attributes on the outbound call span.
+func routeBaggageMembers(ctx context.Context) []baggage.Member {
+	var members []baggage.Member
+	for _, member := range baggage.FromContext(ctx).Members() {
+		if strings.HasPrefix(member.Key(), routeBaggagePrefix) {
+			members = append(members, member)
+		}
+	}
+	return members
+}
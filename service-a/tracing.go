@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	oteltrace "go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/credentials"
+)
+
+// initTracer wires up the OTLP exporter, resource, sampler, and propagator,
+// and registers spanRegistry so /debug/introspect keeps working. All knobs
+// are driven by standard OTEL_* env variables so the demo can be pointed at
+// a real backend (Honeycomb, Grafana, Tempo) instead of just the local
+// collector. It returns a shutdown function that drains the batch span
+// processor before the provider is torn down.
+func initTracer(ctx context.Context) (func(context.Context) error, error) {
+	opts := []otlptracegrpc.Option{
+		otlptracegrpc.WithEndpoint(getEnv("OTEL_EXPORTER_OTLP_ENDPOINT", "otel-collector:4317")),
+		otlptracegrpc.WithRetry(retryConfigFromEnv()),
+	}
+
+	creds, err := tlsCredentialsFromEnv()
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure OTLP TLS credentials: %w", err)
+	}
+	if creds != nil {
+		opts = append(opts, otlptracegrpc.WithTLSCredentials(creds))
+	} else {
+		opts = append(opts, otlptracegrpc.WithInsecure())
+	}
+
+	if raw := getEnv("OTEL_EXPORTER_OTLP_HEADERS", ""); raw != "" {
+		opts = append(opts, otlptracegrpc.WithHeaders(parseOTLPHeaders(raw)))
+	}
+
+	exporter, err := otlptracegrpc.New(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP trace exporter: %w", err)
+	}
+
+	res, err := resource.New(ctx,
+		resource.WithAttributes(
+			semconv.ServiceNameKey.String("service-a"),
+			semconv.ServiceVersionKey.String("1.0.0"),
+		),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create resource: %w", err)
+	}
+
+	// spanRegistry is a SpanProcessor that mirrors every currently active
+	// span so /debug/introspect can answer without waiting for spans to be
+	// batched and exported.
+	tpOpts := []sdktrace.TracerProviderOption{
+		sdktrace.WithSpanProcessor(spanRegistry),
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(samplerFromEnv()),
+	}
+
+	if getEnv("OTEL_EXPORTER_STDOUT_ENABLED", "false") == "true" {
+		stdoutExporter, err := stdouttrace.New(stdouttrace.WithPrettyPrint())
+		if err != nil {
+			return nil, fmt.Errorf("failed to create stdout trace exporter: %w", err)
+		}
+		tpOpts = append(tpOpts, sdktrace.WithBatcher(stdoutExporter))
+	}
+
+	tp := sdktrace.NewTracerProvider(tpOpts...)
+
+	otel.SetTracerProvider(tp)
+	// Compose TraceContext with Baggage so W3C Baggage entries (used by the
+	// router subsystem for label-based routing) ride along with every hop.
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	drainTimeout := getEnvMillis("OTEL_SHUTDOWN_TIMEOUT_MS", 5000)
+	shutdown := func(ctx context.Context) error {
+		drainCtx, cancel := context.WithTimeout(ctx, drainTimeout)
+		defer cancel()
+		if err := tp.ForceFlush(drainCtx); err != nil {
+			log.Printf("Error flushing tracer provider: %v", err)
+		}
+		return tp.Shutdown(drainCtx)
+	}
+
+	return shutdown, nil
+}
+
+// tlsCredentialsFromEnv builds gRPC transport credentials for mutual TLS to
+// the collector. It returns (nil, nil) when OTEL_EXPORTER_OTLP_INSECURE is
+// left at its default of "true", in which case the caller should fall back
+// to otlptracegrpc.WithInsecure().
+func tlsCredentialsFromEnv() (credentials.TransportCredentials, error) {
+	if getEnv("OTEL_EXPORTER_OTLP_INSECURE", "true") == "true" {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{}
+
+	certFile := getEnv("OTEL_EXPORTER_OTLP_CLIENT_CERTIFICATE", "")
+	keyFile := getEnv("OTEL_EXPORTER_OTLP_CLIENT_KEY", "")
+	if certFile != "" && keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if caFile := getEnv("OTEL_EXPORTER_OTLP_CERTIFICATE", ""); caFile != "" {
+		caBytes, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA certificate: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caBytes) {
+			return nil, fmt.Errorf("failed to parse CA certificate from %s", caFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	return credentials.NewTLS(tlsConfig), nil
+}
+
+// parseOTLPHeaders parses the W3C-baggage-style list format used by
+// OTEL_EXPORTER_OTLP_HEADERS: "key1=value1,key2=value2".
+func parseOTLPHeaders(raw string) map[string]string {
+	headers := make(map[string]string)
+	for _, pair := range strings.Split(raw, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		headers[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+	return headers
+}
+
+func retryConfigFromEnv() otlptracegrpc.RetryConfig {
+	return otlptracegrpc.RetryConfig{
+		Enabled:         getEnv("OTEL_EXPORTER_OTLP_RETRY_ENABLED", "true") == "true",
+		InitialInterval: getEnvMillis("OTEL_EXPORTER_OTLP_RETRY_INITIAL_INTERVAL_MS", 5000),
+		MaxInterval:     getEnvMillis("OTEL_EXPORTER_OTLP_RETRY_MAX_INTERVAL_MS", 30000),
+		MaxElapsedTime:  getEnvMillis("OTEL_EXPORTER_OTLP_RETRY_MAX_ELAPSED_TIME_MS", 60000),
+	}
+}
+
+// samplerFromEnv selects a sampler from the standard OTEL_TRACES_SAMPLER /
+// OTEL_TRACES_SAMPLER_ARG env variables, plus a "rate_limited" sampler
+// (arg: traces per second) for capping volume against a paid backend.
+func samplerFromEnv() sdktrace.Sampler {
+	name := strings.ToLower(getEnv("OTEL_TRACES_SAMPLER", "parentbased_always_on"))
+	arg := getEnv("OTEL_TRACES_SAMPLER_ARG", "")
+
+	switch name {
+	case "always_on":
+		return sdktrace.AlwaysSample()
+	case "always_off":
+		return sdktrace.NeverSample()
+	case "traceidratio":
+		return sdktrace.TraceIDRatioBased(parseFloatOr(arg, 1.0))
+	case "parentbased_always_off":
+		return sdktrace.ParentBased(sdktrace.NeverSample())
+	case "parentbased_traceidratio":
+		return sdktrace.ParentBased(sdktrace.TraceIDRatioBased(parseFloatOr(arg, 1.0)))
+	case "rate_limited":
+		return newRateLimitingSampler(parseFloatOr(arg, 100))
+	default:
+		return sdktrace.ParentBased(sdktrace.AlwaysSample())
+	}
+}
+
+func parseFloatOr(raw string, defaultValue float64) float64 {
+	if raw == "" {
+		return defaultValue
+	}
+	if f, err := strconv.ParseFloat(raw, 64); err == nil {
+		return f
+	}
+	return defaultValue
+}
+
+// rateLimitingSampler is a simple token-bucket sampler: it caps the number
+// of traces started per second, independent of trace ID, for demos pointed
+// at a backend that bills per span.
+type rateLimitingSampler struct {
+	mu            sync.Mutex
+	ratePerSecond float64
+	tokens        float64
+	last          time.Time
+}
+
+func newRateLimitingSampler(ratePerSecond float64) *rateLimitingSampler {
+	return &rateLimitingSampler{ratePerSecond: ratePerSecond, tokens: ratePerSecond, last: time.Now()}
+}
+
+func (s *rateLimitingSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	psc := oteltrace.SpanContextFromContext(p.ParentContext)
+	// Child spans of a local parent follow the parent's decision, so only the
+	// span that starts a trace in this process spends a token.
+	if psc.IsValid() && !psc.IsRemote() {
+		decision := sdktrace.Drop
+		if psc.IsSampled() {
+			decision = sdktrace.RecordAndSample
+		}
+		return sdktrace.SamplingResult{Decision: decision, Tracestate: psc.TraceState()}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.tokens += now.Sub(s.last).Seconds() * s.ratePerSecond
+	if s.tokens > s.ratePerSecond {
+		s.tokens = s.ratePerSecond
+	}
+	s.last = now
+
+	decision := sdktrace.Drop
+	if s.tokens >= 1 {
+		s.tokens--
+		decision = sdktrace.RecordAndSample
+	}
+
+	return sdktrace.SamplingResult{Decision: decision, Tracestate: psc.TraceState()}
+}
+
+func (s *rateLimitingSampler) Description() string {
+	return fmt.Sprintf("RateLimitingSampler{%.2f/s}", s.ratePerSecond)
+}